@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"golang.org/x/time/rate"
 	"io"
 	"log"
 	"net"
@@ -14,14 +13,23 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
-const rateLimit = 20
+// defaultMaxUploadSize is used when settings.json omits MaxUploadSize (100MB).
+const defaultMaxUploadSize = 100 << 20
 
-var ipLimitGLB = ipLimiter{
-	limiter: make(map[string]*rate.Limiter),
+// uploadBufPool reuses 32KB buffers for streaming uploads to disk.
+var uploadBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 32*1024)
+		return &b
+	},
 }
 
+// errBodyTooLarge is returned when an upload exceeds settings.MaxUploadSize.
+var errBodyTooLarge = errors.New("request body exceeds maximum allowed size")
+
 var (
 	absPath  string
 	logFile  *os.File
@@ -30,9 +38,17 @@ var (
 )
 
 type settingsType struct {
-	Dir string `json:"dir"`
-	Ip  ipList `json:"ip"`
-	Url string `json:"url"`
+	Dir                string  `json:"dir"`
+	Ip                 ipList  `json:"ip"`
+	Url                string  `json:"url"`
+	MaxUploadSize      int64   `json:"max_upload_size"`
+	ContentAddressed   bool    `json:"content_addressed"`
+	RateLimit          float64 `json:"rate_limit"`
+	RateBurst          int     `json:"rate_burst"`
+	GlobalRateLimit    float64 `json:"global_rate_limit"`
+	GlobalRateBurst    int     `json:"global_rate_burst"`
+	MaxLimiterEntries  int     `json:"max_limiter_entries"`
+	LimiterIdleMinutes int     `json:"limiter_idle_minutes"`
 }
 
 func (s *settingsType) getFileDir() string {
@@ -56,22 +72,81 @@ func (s *settingsType) getURL() string {
 	return s.Url
 }
 
-type ipLimiter struct {
-	limiter map[string]*rate.Limiter
-	mu      sync.Mutex
+func (s *settingsType) getMaxUploadSize() int64 {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if s.MaxUploadSize <= 0 {
+		return defaultMaxUploadSize
+	}
+	return s.MaxUploadSize
+}
+
+func (s *settingsType) getContentAddressed() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return s.ContentAddressed
+}
+
+func (s *settingsType) getRateLimit() float64 {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if s.RateLimit <= 0 {
+		return defaultRateLimit
+	}
+	return s.RateLimit
+}
+
+func (s *settingsType) getRateBurst() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if s.RateBurst <= 0 {
+		return defaultRateBurst
+	}
+	return s.RateBurst
+}
+
+func (s *settingsType) getGlobalRateLimit() float64 {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if s.GlobalRateLimit <= 0 {
+		return defaultGlobalRateLimit
+	}
+	return s.GlobalRateLimit
+}
+
+func (s *settingsType) getGlobalRateBurst() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if s.GlobalRateBurst <= 0 {
+		return defaultGlobalRateBurst
+	}
+	return s.GlobalRateBurst
 }
 
-func (ipl *ipLimiter) getLimiter(ip string) *rate.Limiter {
-	ipl.mu.Lock()
-	defer ipl.mu.Unlock()
+func (s *settingsType) getMaxLimiterEntries() int {
+	mu.RLock()
+	defer mu.RUnlock()
 
-	lim, ok := ipl.limiter[ip]
-	if !ok {
-		lim = rate.NewLimiter(rateLimit, 1)
-		ipl.limiter[ip] = lim
+	if s.MaxLimiterEntries <= 0 {
+		return defaultMaxLimiterEntries
 	}
+	return s.MaxLimiterEntries
+}
 
-	return lim
+func (s *settingsType) getLimiterIdleTTL() time.Duration {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if s.LimiterIdleMinutes <= 0 {
+		return defaultLimiterIdleTTL
+	}
+	return time.Duration(s.LimiterIdleMinutes) * time.Minute
 }
 
 type ipList []string
@@ -87,6 +162,7 @@ func (l *ipList) contains(ip string) bool {
 
 type errResp struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
 }
 
 type jsonResponse struct {
@@ -104,6 +180,7 @@ func readSettings() error {
 		settings.Dir = "C:/ordFiles"
 		settings.Ip = make(ipList, 0)
 		settings.Url = "http://127.0.0.1/okkam/files"
+		settings.MaxUploadSize = defaultMaxUploadSize
 
 		jsonData, err = json.MarshalIndent(settings, "", "  ")
 		if err != nil {
@@ -180,18 +257,15 @@ func sendResponse(w *http.ResponseWriter, jsonData any) {
 	}
 }
 
-func getRequestError(r *http.Request) (*errResp, error) {
+// checkIPAndRateLimit applies the IP allowlist and per-IP rate limit shared
+// by every write endpoint (sendfile, file, move), independent of HTTP method.
+func checkIPAndRateLimit(r *http.Request) (*errResp, error) {
 	var (
 		ip  string
 		err error
 	)
 	eR := errResp{}
 
-	if r.Method != "POST" {
-		eR.Error = "Only POST allowed"
-		return &eR, nil
-	}
-
 	ips := settings.getIPs()
 
 	ip, _, err = net.SplitHostPort(r.RemoteAddr)
@@ -212,6 +286,11 @@ func getRequestError(r *http.Request) (*errResp, error) {
 		}
 	}
 
+	if !globalLimiter.Allow() {
+		eR.Error = "Rate limit exceeded: server is busy"
+		return &eR, nil
+	}
+
 	limiter := ipLimitGLB.getLimiter(ip)
 	if !limiter.Allow() {
 		eR.Error = fmt.Sprintf("Rate limit exceeded for IP: %v", ip)
@@ -221,54 +300,203 @@ func getRequestError(r *http.Request) (*errResp, error) {
 	return nil, nil
 }
 
+func getRequestError(r *http.Request) (*errResp, error) {
+	if r.Method != "POST" {
+		return &errResp{Error: "Only POST allowed"}, nil
+	}
+	return checkIPAndRateLimit(r)
+}
+
+// copyWithPooledBuffer streams src into dst using a buffer borrowed from
+// uploadBufPool instead of allocating one per upload.
+func copyWithPooledBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	bufPtr := uploadBufPool.Get().(*[]byte)
+	defer uploadBufPool.Put(bufPtr)
+
+	return io.CopyBuffer(dst, src, *bufPtr)
+}
+
+// mapUploadError translates the error returned once an http.MaxBytesReader
+// limit is hit into errBodyTooLarge so callers can react with a 413.
+func mapUploadError(err error) error {
+	var mbErr *http.MaxBytesError
+	if errors.As(err, &mbErr) {
+		return errBodyTooLarge
+	}
+	return err
+}
+
 func readRequest(w *http.ResponseWriter, r *http.Request) error {
-	var (
-		body []byte
-		err  error
-		file *os.File
-	)
+	r.Body = http.MaxBytesReader(*w, r.Body, settings.getMaxUploadSize())
+
+	filePth := settings.getFileDir()
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return readMultipartRequest(w, r, filePth)
+	}
+
+	dirList, ok := r.Header["Dir"]
+	if !ok || len(dirList) == 0 {
+		return errors.New("expected Dir header")
+	}
 
-	body, err = io.ReadAll(r.Body)
+	dirPath, err := safeJoin(filePth, dirList[0])
 	if err != nil {
 		return err
 	}
 
-	filePth := settings.getFileDir()
+	fileName, okFile := r.Header["Filename"]
+	if !okFile || len(fileName) == 0 {
+		if _, err = checkUploadPolicy(r, dirPath, ""); err != nil {
+			return err
+		}
+		if l, errDir := os.Stat(dirPath); !(errDir == nil && l.IsDir()) {
+			return os.MkdirAll(dirPath, 777)
+		}
+		return nil
+	}
+
+	policy, err := checkUploadPolicy(r, dirPath, fileName[0])
+	if err != nil {
+		return err
+	}
+
+	if l, errDir := os.Stat(dirPath); !(errDir == nil && l.IsDir()) {
+		errDir = os.MkdirAll(dirPath, 777)
+		if errDir != nil {
+			return errDir
+		}
+	}
+
+	if settings.getContentAddressed() {
+		relURL, errStore := storeContentAddressed(dirPath, dirList[0], fileName[0], r.Body, policy.MaxSize)
+		if errStore != nil {
+			return mapUploadError(errStore)
+		}
+		sendResponse(w, &jsonResponse{Url: relURL})
+		return nil
+	}
+
+	allowedFileName := url.PathEscape(fileName[0])
+	filePath, err := safeJoin(dirPath, allowedFileName)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			loggMessage(&err)
+		}
+	}()
+
+	if _, err = limitedCopy(file, r.Body, policy.MaxSize); err != nil {
+		return mapUploadError(err)
+	}
+
+	jsonData := jsonResponse{Url: fmt.Sprint(settings.getURL(), "/", dirList[0], "/", allowedFileName)}
+	sendResponse(w, &jsonData)
+
+	return nil
+}
+
+// readMultipartRequest streams a multipart/form-data upload straight to disk,
+// part by part, so clients can send large files without the server ever
+// buffering the whole body in memory. It expects a "dir" field ahead of any
+// file part, mirroring the Dir header used by the non-multipart path.
+func readMultipartRequest(w *http.ResponseWriter, r *http.Request, baseDir string) error {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dir     string
+		lastURL string
+	)
+
+	for {
+		part, errPart := mr.NextPart()
+		if errPart == io.EOF {
+			break
+		}
+		if errPart != nil {
+			return mapUploadError(errPart)
+		}
+
+		if part.FormName() == "dir" {
+			var buf strings.Builder
+			if _, err = io.Copy(&buf, part); err != nil {
+				return mapUploadError(err)
+			}
+			dir = buf.String()
+			continue
+		}
+
+		fileName := part.FileName()
+		if fileName == "" {
+			continue
+		}
+		if dir == "" {
+			return errors.New("expected dir field before file part")
+		}
+
+		dirPath, errJoin := safeJoin(baseDir, dir)
+		if errJoin != nil {
+			return errJoin
+		}
+		policy, errPolicy := checkUploadPolicy(r, dirPath, fileName)
+		if errPolicy != nil {
+			return errPolicy
+		}
 
-	if dirList, ok := r.Header["Dir"]; ok && len(dirList) > 0 {
-		dirPath := filepath.Join(filePth, dirList[0])
 		if l, errDir := os.Stat(dirPath); !(errDir == nil && l.IsDir()) {
-			errDir = os.MkdirAll(dirPath, 777)
-			if errDir != nil {
+			if errDir = os.MkdirAll(dirPath, 777); errDir != nil {
 				return errDir
 			}
 		}
 
-		if fileName, okFile := r.Header["Filename"]; okFile && len(fileName) > 0 {
-			allowedFileName := url.PathEscape(fileName[0])
-			filePath := filepath.Join(filePth, dirList[0], allowedFileName)
-			file, err = os.Create(filePath)
-			if err != nil {
-				return err
+		if settings.getContentAddressed() {
+			relURL, errStore := storeContentAddressed(dirPath, dir, fileName, part, policy.MaxSize)
+			if errStore != nil {
+				return mapUploadError(errStore)
 			}
-			defer func() {
-				err = file.Close()
-				if err != nil {
-					loggMessage(&err)
-				}
-			}()
-			_, err = file.Write(body)
-			if err != nil {
-				return err
-			}
-			jsonData := jsonResponse{Url: fmt.Sprint(settings.getURL(), "/", dirList[0], "/", allowedFileName)}
-			sendResponse(w, &jsonData)
+			lastURL = relURL
+			continue
 		}
 
-	} else {
-		return errors.New("expected Dir header")
+		allowedFileName := url.PathEscape(filepath.Base(fileName))
+		filePath, errJoinFile := safeJoin(dirPath, allowedFileName)
+		if errJoinFile != nil {
+			return errJoinFile
+		}
+		file, errCreate := os.Create(filePath)
+		if errCreate != nil {
+			return errCreate
+		}
+
+		_, err = limitedCopy(file, part, policy.MaxSize)
+		errClose := file.Close()
+		if err != nil {
+			return mapUploadError(err)
+		}
+		if errClose != nil {
+			loggMessage(&errClose)
+		}
+
+		lastURL = fmt.Sprint(settings.getURL(), "/", dir, "/", allowedFileName)
+	}
+
+	if lastURL == "" {
+		return errors.New("no file parts found in multipart request")
 	}
 
+	jsonData := jsonResponse{Url: lastURL}
+	sendResponse(w, &jsonData)
+
 	return nil
 }
 
@@ -292,6 +520,10 @@ func requestHandler(w http.ResponseWriter, r *http.Request) {
 			loggMessage(&err)
 			eR = new(errResp)
 			eR.Error = err.Error()
+			if errors.Is(err, errBodyTooLarge) {
+				eR.Code = "BODY_TOO_LARGE"
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+			}
 			sendResponse(&w, &eR)
 			if _, err = fmt.Fprint(w, err.Error()); err != nil {
 				loggMessage(&err)
@@ -302,7 +534,11 @@ func requestHandler(w http.ResponseWriter, r *http.Request) {
 
 func requestHandlerOpen(w http.ResponseWriter, r *http.Request) {
 	rURL := strings.Replace(r.RequestURI, "/okkam/files/", "", -1)
-	filePath := filepath.Join(settings.getFileDir(), rURL)
+	filePath, err := safeJoin(settings.getFileDir(), rURL)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
 	//w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(filePath)))
 	http.ServeFile(w, r, filePath)
 }
@@ -326,6 +562,7 @@ func main() {
 	if err != nil {
 		log.Fatal()
 	}
+	applyGlobalLimiterSettings()
 
 	//Closing the logFile and Exit
 	defer func(logFile *os.File) {
@@ -336,7 +573,15 @@ func main() {
 		os.Exit(0)
 	}(logFile)
 
+	startIndexer()
+	watchSettingsReload()
+
 	http.HandleFunc("/okkam/api/v1/sendfile", requestHandler)
+	http.HandleFunc("/okkam/api/v1/search", searchHandler)
+	http.HandleFunc("/okkam/api/v1/list", listHandler)
+	http.HandleFunc("/okkam/api/v1/file", deleteHandler)
+	http.HandleFunc("/okkam/api/v1/move", moveHandler)
+	http.HandleFunc("/okkam/api/v1/stats", statsHandler)
 	http.Handle("/okkam/files/", http.StripPrefix("/okkam/files/", http.HandlerFunc(requestHandlerOpen)))
 
 	//http.Handle("/okkam/files/", http.StripPrefix("/okkam/files/",
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indexInterval controls how often the background indexer re-walks settings.Dir.
+const indexInterval = 5 * time.Minute
+
+// defaultListPageSize is used when /okkam/api/v1/list omits pageSize.
+const defaultListPageSize = 100
+
+type fileEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	IsDir   bool      `json:"isDir"`
+}
+
+var fileIndex = struct {
+	mu      sync.RWMutex
+	entries []fileEntry
+}{}
+
+// startIndexer launches the background goroutine that keeps fileIndex fresh.
+func startIndexer() {
+	go func() {
+		for {
+			rebuildIndex()
+			time.Sleep(indexInterval)
+		}
+	}()
+}
+
+// rebuildIndex walks settings.Dir and atomically swaps in a fresh snapshot of
+// entries. It is safe to run concurrently with uploads: a partially written
+// file simply shows up with whatever size it has at walk time, and the next
+// tick will pick up the final size.
+func rebuildIndex() {
+	root := settings.getFileDir()
+
+	var entries []fileEntry
+	err := filepath.Walk(root, func(path string, info os.FileInfo, errWalk error) error {
+		if errWalk != nil {
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, errRel := filepath.Rel(root, path)
+		if errRel != nil {
+			return nil
+		}
+
+		entries = append(entries, fileEntry{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		})
+		return nil
+	})
+	if err != nil {
+		loggMessage(&err)
+		return
+	}
+
+	fileIndex.mu.Lock()
+	fileIndex.entries = entries
+	fileIndex.mu.Unlock()
+}
+
+func indexSnapshot() []fileEntry {
+	fileIndex.mu.RLock()
+	defer fileIndex.mu.RUnlock()
+
+	out := make([]fileEntry, len(fileIndex.entries))
+	copy(out, fileIndex.entries)
+	return out
+}
+
+type searchResult struct {
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mtime"`
+	DownloadUrl string    `json:"downloadUrl"`
+}
+
+type searchResponse struct {
+	Results []searchResult `json:"results"`
+}
+
+// searchHandler serves /okkam/api/v1/search?q=...&dir=...&ext=... against the
+// in-memory index built by rebuildIndex.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query()
+	query := strings.ToLower(q.Get("q"))
+	dirFilter := filepath.ToSlash(strings.Trim(q.Get("dir"), "/"))
+	extFilter := strings.ToLower(q.Get("ext"))
+	if extFilter != "" && !strings.HasPrefix(extFilter, ".") {
+		extFilter = "." + extFilter
+	}
+
+	var results []searchResult
+	for _, e := range indexSnapshot() {
+		if e.IsDir {
+			continue
+		}
+		if dirFilter != "" && e.Path != dirFilter && !strings.HasPrefix(e.Path, dirFilter+"/") {
+			continue
+		}
+		if extFilter != "" && !strings.EqualFold(filepath.Ext(e.Path), extFilter) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(e.Path), query) {
+			continue
+		}
+		results = append(results, searchResult{
+			Path:        e.Path,
+			Size:        e.Size,
+			ModTime:     e.ModTime,
+			DownloadUrl: fmt.Sprint(settings.getURL(), "/", e.Path),
+		})
+	}
+
+	sendResponse(&w, &searchResponse{Results: results})
+}
+
+type listEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	IsDir   bool      `json:"isDir"`
+	ModTime time.Time `json:"mtime"`
+}
+
+type listResponse struct {
+	Dir      string      `json:"dir"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+	Total    int         `json:"total"`
+	Entries  []listEntry `json:"entries"`
+}
+
+// listHandler serves /okkam/api/v1/list?dir=...&page=...&pageSize=..., a
+// paginated directory listing for callers that don't want the full index.
+func listHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query()
+	reqDir := strings.Trim(q.Get("dir"), "/")
+	root := settings.getFileDir()
+
+	dirPath, err := safeJoin(root, reqDir)
+	if err != nil {
+		sendResponse(&w, &errResp{Error: "invalid dir"})
+		return
+	}
+
+	dirEntries, err := os.ReadDir(dirPath)
+	if err != nil {
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(q.Get("pageSize"))
+	if pageSize < 1 {
+		pageSize = defaultListPageSize
+	}
+
+	var all []listEntry
+	for _, de := range dirEntries {
+		if strings.HasPrefix(de.Name(), ".") {
+			continue
+		}
+		info, errInfo := de.Info()
+		if errInfo != nil {
+			continue
+		}
+		all = append(all, listEntry{
+			Name:    de.Name(),
+			Size:    info.Size(),
+			IsDir:   de.IsDir(),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	start := (page - 1) * pageSize
+	if start > len(all) {
+		start = len(all)
+	}
+	end := start + pageSize
+	if end > len(all) {
+		end = len(all)
+	}
+
+	sendResponse(&w, &listResponse{
+		Dir:      reqDir,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    len(all),
+		Entries:  all[start:end],
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRateLimit         = 20
+	defaultRateBurst         = 1
+	defaultGlobalRateLimit   = 200
+	defaultGlobalRateBurst   = 20
+	defaultMaxLimiterEntries = 10000
+	defaultLimiterIdleTTL    = 10 * time.Minute
+	limiterJanitorInterval   = time.Minute
+)
+
+// globalLimiter bounds total request rate across all clients, independent of
+// the per-IP limiters in ipLimitGLB. It starts out with the compiled-in
+// defaults and is re-tuned by applyGlobalLimiterSettings once settings.json
+// has been read (and again on every reloadSettings).
+var globalLimiter = rate.NewLimiter(rate.Limit(defaultGlobalRateLimit), defaultGlobalRateBurst)
+
+// applyGlobalLimiterSettings pushes the current settings.json values onto
+// globalLimiter. Unlike the per-IP limiters, which are created lazily with
+// whatever settings are current at that moment, globalLimiter is a single
+// long-lived limiter, so it must be explicitly refreshed whenever settings
+// change instead of picking them up automatically.
+func applyGlobalLimiterSettings() {
+	globalLimiter.SetLimit(rate.Limit(settings.getGlobalRateLimit()))
+	globalLimiter.SetBurst(settings.getGlobalRateBurst())
+}
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipLimiterRegistry replaces the old unbounded map[string]*rate.Limiter: it
+// caps the number of tracked IPs and a background janitor evicts entries
+// that have been idle longer than the configured TTL, so a flood of
+// one-off client IPs can't grow the map forever.
+type ipLimiterRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*limiterEntry
+}
+
+var ipLimitGLB = newIPLimiterRegistry()
+
+func newIPLimiterRegistry() *ipLimiterRegistry {
+	reg := &ipLimiterRegistry{entries: make(map[string]*limiterEntry)}
+	go reg.janitor()
+	return reg
+}
+
+func (reg *ipLimiterRegistry) getLimiter(ip string) *rate.Limiter {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if e, ok := reg.entries[ip]; ok {
+		e.lastSeen = time.Now()
+		return e.limiter
+	}
+
+	if len(reg.entries) >= settings.getMaxLimiterEntries() {
+		reg.evictOldestLocked()
+	}
+
+	lim := rate.NewLimiter(rate.Limit(settings.getRateLimit()), settings.getRateBurst())
+	reg.entries[ip] = &limiterEntry{limiter: lim, lastSeen: time.Now()}
+	return lim
+}
+
+// retuneAll pushes the current settings.json rate/burst onto every
+// already-tracked limiter. Without this, an IP seen before a reloadSettings
+// keeps its old limiter until it's idle long enough to be evicted, so a
+// hot-reloaded rate_limit/rate_burst would otherwise only apply to newly-seen
+// IPs.
+func (reg *ipLimiterRegistry) retuneAll() {
+	limit := rate.Limit(settings.getRateLimit())
+	burst := settings.getRateBurst()
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for _, e := range reg.entries {
+		e.limiter.SetLimit(limit)
+		e.limiter.SetBurst(burst)
+	}
+}
+
+// evictOldestLocked drops the least-recently-seen entry to make room for a
+// new one once the registry is at capacity. Callers must hold reg.mu.
+func (reg *ipLimiterRegistry) evictOldestLocked() {
+	var (
+		oldestIP   string
+		oldestSeen time.Time
+		found      bool
+	)
+	for ip, e := range reg.entries {
+		if !found || e.lastSeen.Before(oldestSeen) {
+			oldestIP, oldestSeen, found = ip, e.lastSeen, true
+		}
+	}
+	if found {
+		delete(reg.entries, oldestIP)
+	}
+}
+
+func (reg *ipLimiterRegistry) janitor() {
+	ticker := time.NewTicker(limiterJanitorInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reg.evictIdle()
+	}
+}
+
+func (reg *ipLimiterRegistry) evictIdle() {
+	cutoff := time.Now().Add(-settings.getLimiterIdleTTL())
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for ip, e := range reg.entries {
+		if e.lastSeen.Before(cutoff) {
+			delete(reg.entries, ip)
+		}
+	}
+}
+
+type limiterStat struct {
+	Ip       string    `json:"ip"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+func (reg *ipLimiterRegistry) snapshot() []limiterStat {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	out := make([]limiterStat, 0, len(reg.entries))
+	for ip, e := range reg.entries {
+		out = append(out, limiterStat{Ip: ip, LastSeen: e.lastSeen})
+	}
+	return out
+}
+
+type statsResponse struct {
+	ActiveLimiters  int           `json:"activeLimiters"`
+	MaxEntries      int           `json:"maxEntries"`
+	RateLimit       float64       `json:"rateLimit"`
+	RateBurst       int           `json:"rateBurst"`
+	GlobalRateLimit float64       `json:"globalRateLimit"`
+	GlobalRateBurst int           `json:"globalRateBurst"`
+	Limiters        []limiterStat `json:"limiters"`
+}
+
+// statsHandler serves /okkam/api/v1/stats so operators can see how many IPs
+// are currently being tracked and at what rate they're limited.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	resp := statsResponse{
+		MaxEntries:      settings.getMaxLimiterEntries(),
+		RateLimit:       settings.getRateLimit(),
+		RateBurst:       settings.getRateBurst(),
+		GlobalRateLimit: settings.getGlobalRateLimit(),
+		GlobalRateBurst: settings.getGlobalRateBurst(),
+		Limiters:        ipLimitGLB.snapshot(),
+	}
+	resp.ActiveLimiters = len(resp.Limiters)
+
+	sendResponse(&w, &resp)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+type deleteRequest struct {
+	Dir      string `json:"dir"`
+	Filename string `json:"filename"`
+}
+
+type moveRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type opResponse struct {
+	Ok bool `json:"ok"`
+}
+
+// renameOrCopy moves from to to, falling back to a copy-then-delete when
+// os.Rename fails because the paths cross filesystem devices.
+func renameOrCopy(from, to string) error {
+	err := os.Rename(from, to)
+	if err == nil {
+		return nil
+	}
+
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) {
+		return err
+	}
+
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+
+	if _, err = copyWithPooledBuffer(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(from)
+}
+
+// deleteHandler serves DELETE /okkam/api/v1/file {dir, filename}.
+func deleteHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodDelete {
+		sendResponse(&w, &errResp{Error: "Only DELETE allowed"})
+		return
+	}
+
+	if eR, err := checkIPAndRateLimit(r); err != nil {
+		loggMessage(&err)
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	} else if eR != nil {
+		sendResponse(&w, eR)
+		return
+	}
+
+	var req deleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+
+	root := settings.getFileDir()
+	dirPath, err := safeJoin(root, req.Dir)
+	if err != nil {
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+
+	filePath, err := safeJoin(dirPath, req.Filename)
+	if err != nil {
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+
+	// Resolve the policy against filePath's actual parent, not dirPath: a
+	// req.Filename containing a "/" (e.g. "locked/secret.txt") targets a
+	// directory deeper than req.Dir, and that deeper directory may carry its
+	// own .okkam.yml restricting delete/allowed_ips.
+	policy, err := resolvePolicy(filepath.Dir(filePath))
+	if err != nil {
+		loggMessage(&err)
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+	if !policy.deleteAllowed() {
+		sendResponse(&w, &errResp{Error: "delete is not allowed in this directory"})
+		return
+	}
+	if ip := policyClientIP(r); !policy.ipAllowed(ip) {
+		sendResponse(&w, &errResp{Error: fmt.Sprintf("IP is not allowed to delete here: %v", ip)})
+		return
+	}
+
+	if err = os.Remove(filePath); err != nil {
+		loggMessage(&err)
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+
+	loggMessage(fmt.Sprintf("[audit] delete file=%s ip=%s", filePath, policyClientIP(r)))
+	sendResponse(&w, &opResponse{Ok: true})
+}
+
+// moveHandler serves POST /okkam/api/v1/move {from, to}.
+func moveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		sendResponse(&w, &errResp{Error: "Only POST allowed"})
+		return
+	}
+
+	if eR, err := checkIPAndRateLimit(r); err != nil {
+		loggMessage(&err)
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	} else if eR != nil {
+		sendResponse(&w, eR)
+		return
+	}
+
+	var req moveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+
+	root := settings.getFileDir()
+	fromPath, err := safeJoin(root, req.From)
+	if err != nil {
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+	toPath, err := safeJoin(root, req.To)
+	if err != nil {
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+
+	fromPolicy, err := resolvePolicy(filepath.Dir(fromPath))
+	if err != nil {
+		loggMessage(&err)
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+	if !fromPolicy.deleteAllowed() {
+		sendResponse(&w, &errResp{Error: "move is not allowed out of this directory"})
+		return
+	}
+	ip := policyClientIP(r)
+	if !fromPolicy.ipAllowed(ip) {
+		sendResponse(&w, &errResp{Error: fmt.Sprintf("IP is not allowed to move from this directory: %v", ip)})
+		return
+	}
+
+	toPolicy, err := resolvePolicy(filepath.Dir(toPath))
+	if err != nil {
+		loggMessage(&err)
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+	if !toPolicy.uploadAllowed() {
+		sendResponse(&w, &errResp{Error: "move is not allowed into this directory"})
+		return
+	}
+	if !toPolicy.ipAllowed(ip) {
+		sendResponse(&w, &errResp{Error: fmt.Sprintf("IP is not allowed to move into this directory: %v", ip)})
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(toPath), 777); err != nil {
+		loggMessage(&err)
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+
+	if err = renameOrCopy(fromPath, toPath); err != nil {
+		loggMessage(&err)
+		sendResponse(&w, &errResp{Error: err.Error()})
+		return
+	}
+
+	loggMessage(fmt.Sprintf("[audit] move from=%s to=%s ip=%s", fromPath, toPath, ip))
+	sendResponse(&w, &opResponse{Ok: true})
+}
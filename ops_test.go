@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withTestSettings points settings at dir and opens the rate limiters up wide
+// enough that the gating tests below exercise policy checks, not rate
+// limiting, then restores the previous settings once the test finishes.
+func withTestSettings(t *testing.T, dir string) {
+	t.Helper()
+	orig := settings
+	settings = settingsType{
+		Dir:             dir,
+		RateLimit:       1000,
+		RateBurst:       1000,
+		GlobalRateLimit: 1000,
+		GlobalRateBurst: 1000,
+	}
+	applyGlobalLimiterSettings()
+	t.Cleanup(func() {
+		settings = orig
+		applyGlobalLimiterSettings()
+	})
+}
+
+func TestDeleteHandlerRespectsNestedPolicy(t *testing.T) {
+	root := t.TempDir()
+	locked := filepath.Join(root, "public", "locked")
+	if err := os.MkdirAll(locked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePolicy(t, filepath.Join(root, "public"), "delete: true\n")
+	writePolicy(t, locked, "delete: false\n")
+
+	target := filepath.Join(locked, "secret.txt")
+	if err := os.WriteFile(target, []byte("top secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	withTestSettings(t, root)
+
+	body, _ := json.Marshal(deleteRequest{Dir: "public", Filename: "locked/secret.txt"})
+	req := httptest.NewRequest(http.MethodDelete, "/okkam/api/v1/file", bytes.NewReader(body))
+	req.RemoteAddr = "203.0.113.21:4545"
+	rec := httptest.NewRecorder()
+
+	deleteHandler(rec, req)
+
+	if _, err := os.Stat(target); err != nil {
+		t.Fatalf("expected file to survive a delete denied by the nested policy: %v", err)
+	}
+
+	var resp errResp
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Error == "" {
+		t.Fatalf("expected a policy error, got empty response: %+v", resp)
+	}
+}
+
+func TestMoveHandlerRespectsAllowedIPs(t *testing.T) {
+	root := t.TempDir()
+	srcDir := filepath.Join(root, "src")
+	dstDir := filepath.Join(root, "dst")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePolicy(t, srcDir, "delete: true\nallowed_ips: [\"203.0.113.9\"]\n")
+
+	srcFile := filepath.Join(srcDir, "file.txt")
+	if err := os.WriteFile(srcFile, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	withTestSettings(t, root)
+
+	body, _ := json.Marshal(moveRequest{From: "src/file.txt", To: "dst/file.txt"})
+	req := httptest.NewRequest(http.MethodPost, "/okkam/api/v1/move", bytes.NewReader(body))
+	req.RemoteAddr = "203.0.113.22:4545"
+	rec := httptest.NewRecorder()
+
+	moveHandler(rec, req)
+
+	if _, err := os.Stat(srcFile); err != nil {
+		t.Fatalf("expected source file to remain after a move denied by allowed_ips: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "file.txt")); err == nil {
+		t.Fatalf("expected the move to be denied, but the destination file exists")
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// policyFileName is the per-directory policy file, checked into any
+// subdirectory of settings.Dir, akin to gohttpserver's .ghs.yml.
+const policyFileName = ".okkam.yml"
+
+// dirPolicy mirrors the fields operators can set in a policyFileName file.
+// Pointer fields distinguish "unset" (inherit from a parent directory) from
+// an explicit false.
+type dirPolicy struct {
+	Upload            *bool    `yaml:"upload"`
+	Delete            *bool    `yaml:"delete"`
+	AllowedIPs        []string `yaml:"allowed_ips"`
+	MaxSize           int64    `yaml:"max_size"`
+	AllowedExtensions []string `yaml:"allowed_extensions"`
+}
+
+func (p dirPolicy) uploadAllowed() bool {
+	if p.Upload == nil {
+		return true
+	}
+	return *p.Upload
+}
+
+func (p dirPolicy) deleteAllowed() bool {
+	if p.Delete == nil {
+		return false
+	}
+	return *p.Delete
+}
+
+func (p dirPolicy) ipAllowed(ip string) bool {
+	if len(p.AllowedIPs) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedIPs {
+		if allowed == ip {
+			return true
+		}
+	}
+	return false
+}
+
+func (p dirPolicy) extensionAllowed(name string) bool {
+	if len(p.AllowedExtensions) == 0 {
+		return true
+	}
+	ext := filepath.Ext(name)
+	for _, allowed := range p.AllowedExtensions {
+		if strings.EqualFold(allowed, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+type cachedPolicy struct {
+	policy  dirPolicy
+	modTime time.Time
+}
+
+var policyCache = struct {
+	mu    sync.Mutex
+	byDir map[string]cachedPolicy
+}{byDir: make(map[string]cachedPolicy)}
+
+// loadDirPolicy reads and caches the policyFileName file directly inside dir,
+// if any. The cache entry is invalidated whenever the file's mtime changes.
+func loadDirPolicy(dir string) (dirPolicy, error) {
+	path := filepath.Join(dir, policyFileName)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dirPolicy{}, nil
+		}
+		return dirPolicy{}, err
+	}
+
+	policyCache.mu.Lock()
+	defer policyCache.mu.Unlock()
+
+	if cached, ok := policyCache.byDir[path]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.policy, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return dirPolicy{}, err
+	}
+
+	var p dirPolicy
+	if err = yaml.Unmarshal(data, &p); err != nil {
+		return dirPolicy{}, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	policyCache.byDir[path] = cachedPolicy{policy: p, modTime: info.ModTime()}
+	return p, nil
+}
+
+// mergePolicy layers override on top of base: any field override sets
+// explicitly wins, anything left unset falls through to base.
+func mergePolicy(base, override dirPolicy) dirPolicy {
+	merged := base
+	if override.Upload != nil {
+		merged.Upload = override.Upload
+	}
+	if override.Delete != nil {
+		merged.Delete = override.Delete
+	}
+	if len(override.AllowedIPs) > 0 {
+		merged.AllowedIPs = override.AllowedIPs
+	}
+	if override.MaxSize > 0 {
+		merged.MaxSize = override.MaxSize
+	}
+	if len(override.AllowedExtensions) > 0 {
+		merged.AllowedExtensions = override.AllowedExtensions
+	}
+	return merged
+}
+
+// resolvePolicy walks from settings.Dir down to targetDir, merging each
+// directory's policyFileName file so that a policy closer to targetDir
+// overrides one declared nearer the root.
+func resolvePolicy(targetDir string) (dirPolicy, error) {
+	root := settings.getFileDir()
+
+	rel, err := filepath.Rel(root, targetDir)
+	if err != nil {
+		return dirPolicy{}, err
+	}
+	if rel == "." {
+		rel = ""
+	}
+
+	var segments []string
+	if rel != "" {
+		segments = strings.Split(filepath.ToSlash(rel), "/")
+	}
+
+	merged, err := loadDirPolicy(root)
+	if err != nil {
+		return dirPolicy{}, err
+	}
+
+	current := root
+	for _, seg := range segments {
+		current = filepath.Join(current, seg)
+		p, errLoad := loadDirPolicy(current)
+		if errLoad != nil {
+			return dirPolicy{}, errLoad
+		}
+		merged = mergePolicy(merged, p)
+	}
+
+	return merged, nil
+}
+
+// policyClientIP extracts the same client IP that getRequestError uses, so
+// per-directory policies and the global IP allowlist agree on who "the
+// client" is.
+func policyClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if xri := r.Header.Get("X-Real-Ip"); len(xri) > 0 {
+		if rIP := net.ParseIP(xri); rIP != nil {
+			ip = rIP.String()
+		}
+	}
+	return ip
+}
+
+// checkUploadPolicy resolves the effective policy for dirPath and rejects the
+// request if uploads are disabled, the client IP isn't allowlisted, or
+// fileName's extension isn't permitted. fileName may be empty when it is not
+// yet known, in which case the extension check is skipped. The resolved
+// policy is returned so callers can also enforce its MaxSize while streaming
+// the upload.
+func checkUploadPolicy(r *http.Request, dirPath, fileName string) (dirPolicy, error) {
+	policy, err := resolvePolicy(dirPath)
+	if err != nil {
+		return dirPolicy{}, err
+	}
+
+	if !policy.uploadAllowed() {
+		return policy, errors.New("upload is not allowed in this directory")
+	}
+
+	ip := policyClientIP(r)
+	if !policy.ipAllowed(ip) {
+		return policy, fmt.Errorf("IP is not allowed to upload here: %v", ip)
+	}
+
+	if fileName != "" && !policy.extensionAllowed(fileName) {
+		return policy, fmt.Errorf("file extension is not allowed: %v", filepath.Ext(fileName))
+	}
+
+	return policy, nil
+}
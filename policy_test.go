@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergePolicyOverrides(t *testing.T) {
+	upload := true
+	base := dirPolicy{Upload: &upload, AllowedExtensions: []string{".txt"}}
+
+	deleteFalse := false
+	override := dirPolicy{Delete: &deleteFalse, MaxSize: 10}
+
+	merged := mergePolicy(base, override)
+
+	if merged.Upload == nil || !*merged.Upload {
+		t.Fatalf("expected upload to be inherited from base, got %v", merged.Upload)
+	}
+	if merged.Delete == nil || *merged.Delete {
+		t.Fatalf("expected delete to be overridden to false, got %v", merged.Delete)
+	}
+	if merged.MaxSize != 10 {
+		t.Fatalf("expected max_size override to apply, got %d", merged.MaxSize)
+	}
+	if len(merged.AllowedExtensions) != 1 || merged.AllowedExtensions[0] != ".txt" {
+		t.Fatalf("expected allowed_extensions to be inherited from base, got %v", merged.AllowedExtensions)
+	}
+}
+
+func TestResolvePolicyMergesNestedFiles(t *testing.T) {
+	root := t.TempDir()
+	locked := filepath.Join(root, "public", "locked")
+	if err := os.MkdirAll(locked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePolicy(t, filepath.Join(root, "public"), "upload: true\ndelete: true\n")
+	writePolicy(t, locked, "delete: false\nallowed_ips: [\"10.0.0.1\"]\n")
+
+	origDir := settings.Dir
+	settings.Dir = root
+	defer func() { settings.Dir = origDir }()
+
+	policy, err := resolvePolicy(locked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.uploadAllowed() {
+		t.Fatalf("expected upload to be inherited from the parent policy")
+	}
+	if policy.deleteAllowed() {
+		t.Fatalf("expected the nested policy to override delete to false")
+	}
+	if policy.ipAllowed("10.0.0.2") {
+		t.Fatalf("expected a non-allowlisted IP to be rejected")
+	}
+	if !policy.ipAllowed("10.0.0.1") {
+		t.Fatalf("expected the allowlisted IP to pass")
+	}
+}
+
+func writePolicy(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, policyFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// validateSettings rejects a parsed settingsType before it replaces the live
+// settings, so a bad settings.json (typo'd dir, malformed URL, garbage IP)
+// can't take the server down mid-flight.
+func validateSettings(s settingsType) error {
+	if strings.TrimSpace(s.Dir) == "" {
+		return errors.New("dir must not be empty")
+	}
+	info, err := os.Stat(s.Dir)
+	if err != nil {
+		return fmt.Errorf("dir does not exist: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("dir is not a directory: %v", s.Dir)
+	}
+
+	if _, err = url.Parse(s.Url); err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+
+	for _, ip := range s.Ip {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid ip in allowlist: %v", ip)
+		}
+	}
+
+	return nil
+}
+
+// reloadSettings re-reads settings.json and swaps it in under the write
+// lock, but only once the new values pass validateSettings. On failure the
+// previous settings keep serving and the error is logged, so operators don't
+// lose in-flight rate-limit state or the upload directory to a typo.
+func reloadSettings() error {
+	jsonFile := filepath.Join(absPath, "settings.json")
+
+	jsonData, err := os.ReadFile(jsonFile)
+	if err != nil {
+		return err
+	}
+
+	var newSettings settingsType
+	if err = json.Unmarshal(jsonData, &newSettings); err != nil {
+		return err
+	}
+
+	if err = validateSettings(newSettings); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	settings = newSettings
+	mu.Unlock()
+
+	applyGlobalLimiterSettings()
+	ipLimitGLB.retuneAll()
+
+	loggMessage(fmt.Sprintf("settings reloaded from %s", jsonFile))
+	return nil
+}
+
+// watchSettingsReload wires reloadSettings up to a SIGHUP and, best-effort,
+// to an fsnotify watch on settings.json so operators can change the IP
+// allowlist or upload directory without restarting the process.
+func watchSettingsReload() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	go func() {
+		for range sigCh {
+			if err := reloadSettings(); err != nil {
+				loggMessage(&err)
+			}
+		}
+	}()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		loggMessage(&err)
+		return
+	}
+
+	settingsFile := filepath.Join(absPath, "settings.json")
+	if err = watcher.Add(filepath.Dir(settingsFile)); err != nil {
+		loggMessage(&err)
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(settingsFile) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if errReload := reloadSettings(); errReload != nil {
+					loggMessage(&errReload)
+				}
+			case errWatch, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				loggMessage(&errWatch)
+			}
+		}
+	}()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// contentAddressTempPrefix names the scratch file a content-addressed upload
+// is hashed into before being renamed to its final <sha256>/<name> path.
+const contentAddressTempPrefix = ".okkam-upload-"
+
+// safeJoin joins parts onto base and rejects the result if it resolves
+// outside base, e.g. via a ".." segment smuggled in through a Dir header or
+// request body. All file operations that incorporate client-supplied path
+// segments must go through this instead of a bare filepath.Join.
+func safeJoin(base string, parts ...string) (string, error) {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+
+	joined := filepath.Join(append([]string{absBase}, parts...)...)
+	absJoined, err := filepath.Abs(joined)
+	if err != nil {
+		return "", err
+	}
+
+	if absJoined != absBase && !strings.HasPrefix(absJoined, absBase+string(os.PathSeparator)) {
+		return "", fmt.Errorf("path escapes base directory: %v", absJoined)
+	}
+
+	return absJoined, nil
+}
+
+// limitedCopy streams src into dst like copyWithPooledBuffer, but returns
+// errBodyTooLarge instead of writing more than maxSize bytes. maxSize <= 0
+// means no additional limit beyond whatever the caller already applied to
+// src (e.g. settings.MaxUploadSize via http.MaxBytesReader).
+func limitedCopy(dst io.Writer, src io.Reader, maxSize int64) (int64, error) {
+	if maxSize <= 0 {
+		return copyWithPooledBuffer(dst, src)
+	}
+
+	n, err := copyWithPooledBuffer(dst, io.LimitReader(src, maxSize+1))
+	if err != nil {
+		return n, err
+	}
+	if n > maxSize {
+		return n, errBodyTooLarge
+	}
+	return n, nil
+}
+
+// storeContentAddressed hashes src while streaming it to a temp file inside
+// dirPath, then renames it to dirPath/<sha256>/<fileName>. Deduplication is
+// keyed on the digest alone, not on (digest, fileName): if dirPath/<sha256>
+// already holds any file, the temp file is discarded and that existing
+// file's URL is returned, regardless of what name this upload asked for.
+// maxSize, when positive, enforces the resolved per-directory policy's
+// max_size.
+func storeContentAddressed(dirPath, dirRel, fileName string, src io.Reader, maxSize int64) (string, error) {
+	if err := os.MkdirAll(dirPath, 777); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dirPath, contentAddressTempPrefix)
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	hasher := sha256.New()
+	if _, err = limitedCopy(io.MultiWriter(tmp, hasher), src, maxSize); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+
+	digest := hex.EncodeToString(hasher.Sum(nil))
+	allowedFileName := url.PathEscape(fileName)
+	destDir, err := safeJoin(dirPath, digest)
+	if err != nil {
+		return "", err
+	}
+
+	if existing, statErr := existingDigestEntry(destDir); statErr == nil && existing != "" {
+		return fmt.Sprint(settings.getURL(), "/", dirRel, "/", digest, "/", existing), nil
+	}
+
+	destPath, err := safeJoin(destDir, allowedFileName)
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.MkdirAll(destDir, 777); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmpPath, destPath); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprint(settings.getURL(), "/", dirRel, "/", digest, "/", allowedFileName), nil
+}
+
+// existingDigestEntry returns the name of a file already stored under a
+// content-address directory, if any, so a repeat upload of the same digest
+// can be deduplicated regardless of what name it was uploaded under.
+func existingDigestEntry(destDir string) (string, error) {
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			return e.Name(), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSafeJoinRejectsEscapes(t *testing.T) {
+	base := t.TempDir()
+
+	cases := []struct {
+		name    string
+		parts   []string
+		wantErr bool
+	}{
+		{"plain nested path", []string{"sub", "file.txt"}, false},
+		{"base itself", nil, false},
+		{"dot dot escape", []string{"..", "etc", "passwd"}, true},
+		{"nested dot dot escape", []string{"sub", "..", "..", "secret"}, true},
+		{"sibling directory escape", []string{"..", "sibling", "secret.txt"}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resolved, err := safeJoin(base, c.parts...)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for parts %v, got path %q", c.parts, resolved)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for parts %v: %v", c.parts, err)
+			}
+			if resolved != base && !strings.HasPrefix(resolved, base+string(os.PathSeparator)) {
+				t.Fatalf("resolved path %q escaped base %q", resolved, base)
+			}
+		})
+	}
+}